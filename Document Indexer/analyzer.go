@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Analyzer turns raw document (or query) text into the sequence of terms
+// the index is built from. Both indexing (mapFile) and querying
+// (SearchEngine.Analyze) go through the same Analyzer, so a stemming or
+// stop-word-filtering pipeline stays consistent end to end.
+type Analyzer interface {
+	Tokenize(r io.Reader) []string
+}
+
+// TokenFilter transforms a token stream, e.g. lowercasing, dropping
+// stop-words, or stemming. Filters run in the order they're chained.
+type TokenFilter interface {
+	Filter(tokens []string) []string
+}
+
+// tokenizeRegex extracts "terms" from text. It keeps internal apostrophes,
+// e.g. o'er or o’er becomes one term. Unicode apostrophe (’) is supported.
+var tokenizeRegex = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’][\p{L}\p{N}]+)*`)
+
+// baseTokenize splits r into raw tokens via tokenizeRegex, line by line.
+// It does no case-folding or filtering; that's left to TokenFilters.
+func baseTokenize(r io.Reader) []string {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	// Some Shakespeare lines can be long; increase buffer to avoid token too long.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tokens = append(tokens, tokenizeRegex.FindAllString(scanner.Text(), -1)...)
+	}
+	return tokens
+}
+
+// pipelineAnalyzer tokenizes with baseTokenize and then runs the result
+// through a chain of TokenFilters.
+type pipelineAnalyzer struct {
+	filters []TokenFilter
+}
+
+func (a pipelineAnalyzer) Tokenize(r io.Reader) []string {
+	tokens := baseTokenize(r)
+	for _, f := range a.filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+// lowercaseFilter folds every token to lower case.
+type lowercaseFilter struct{}
+
+func (lowercaseFilter) Filter(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = strings.ToLower(t)
+	}
+	return out
+}
+
+// stopWordFilter drops any token present in words.
+type stopWordFilter struct{ words map[string]struct{} }
+
+func (f stopWordFilter) Filter(tokens []string) []string {
+	out := tokens[:0]
+	for _, t := range tokens {
+		if _, stop := f.words[t]; !stop {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// stemFilter maps each token through a stemming function.
+type stemFilter struct{ stem func(string) string }
+
+func (f stemFilter) Filter(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = f.stem(t)
+	}
+	return out
+}
+
+// NewNoneAnalyzer returns the backwards-compatible analyzer: lowercase
+// only, no stop-word removal and no stemming.
+func NewNoneAnalyzer() Analyzer {
+	return pipelineAnalyzer{filters: []TokenFilter{lowercaseFilter{}}}
+}
+
+// NewEnglishAnalyzer returns an analyzer for English text: lowercase,
+// drop common English stop-words, then apply a Porter-style stemmer.
+func NewEnglishAnalyzer() Analyzer {
+	return pipelineAnalyzer{filters: []TokenFilter{
+		lowercaseFilter{},
+		stopWordFilter{words: enStopWords},
+		stemFilter{stem: stemEnglish},
+	}}
+}
+
+// NewRussianAnalyzer returns an analyzer for Russian text: lowercase,
+// drop common Russian stop-words, then apply a Snowball-style ru stemmer.
+func NewRussianAnalyzer() Analyzer {
+	return pipelineAnalyzer{filters: []TokenFilter{
+		lowercaseFilter{},
+		stopWordFilter{words: ruStopWords},
+		stemFilter{stem: stemRussian},
+	}}
+}
+
+// AnalyzerByName resolves the --analyzer flag value to an Analyzer.
+func AnalyzerByName(name string) (Analyzer, error) {
+	switch name {
+	case "", "none":
+		return NewNoneAnalyzer(), nil
+	case "en":
+		return NewEnglishAnalyzer(), nil
+	case "ru":
+		return NewRussianAnalyzer(), nil
+	default:
+		return nil, fmt.Errorf("unknown analyzer %q (want none, en, or ru)", name)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"index/suffixarray"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// snippetRadius is how many bytes of context to include on each side of a
+// fulltext match in Hit.Snippet.
+const snippetRadius = 30
+
+// docSeparator is written between documents in a fullTextIndex's
+// concatenated buffer. It's a byte that can't occur in tokenized text, so
+// a match that includes it must span two documents; hit uses that to
+// reject such matches instead of silently attributing them to whichever
+// document the match offset happens to start in.
+const docSeparator = 0x00
+
+// Hit is a single match from the suffix-array fulltext index.
+type Hit struct {
+	Doc     string // document path the match falls in
+	Offset  int    // byte offset of the match within Doc
+	Snippet string // a short window of text around the match
+}
+
+// docBreak records where docID's content starts and ends within a
+// fullTextIndex's concatenated buffer. [offset, end) is the document's own
+// content; buf[end] is a docSeparator byte, not part of any document.
+type docBreak struct {
+	offset int
+	end    int
+	doc    string
+}
+
+// fullTextIndex is a suffix array over the concatenation of every
+// document's content, for substring/regex search that the term-only
+// inverted index can't satisfy. It's built in parallel with, not instead
+// of, SearchEngine's inverted index, and is memory-hungry (suffix arrays
+// typically run 4-8x the size of the indexed bytes), so it's opt-in via
+// the --fulltext flag.
+type fullTextIndex struct {
+	buf    []byte
+	breaks []docBreak // sorted by offset, ascending
+	sa     *suffixarray.Index
+}
+
+// ftSource is a file to fold into a fullTextIndex: its path and the size
+// buildFullTextIndex should check against maxFileBytes without having to
+// stat the file again.
+type ftSource struct {
+	path string
+	size int64
+}
+
+// buildFullTextIndex reads every file in sources and builds a
+// fullTextIndex over their concatenation, with a docSeparator byte between
+// each pair of documents so a match can never silently span two of them.
+// maxFileBytes and maxTotalBytes apply the same limits as readStage
+// (pipeline.go) does for the inverted index, so --fulltext doesn't read
+// and buffer content that was excluded from indexing for being oversized
+// (0 = unlimited for either).
+func buildFullTextIndex(sources []ftSource, maxFileBytes, maxTotalBytes int64) (*fullTextIndex, error) {
+	var buf bytes.Buffer
+	breaks := make([]docBreak, 0, len(sources))
+	var totalRead int64
+	var budgetWarned bool
+	for _, s := range sources {
+		if maxFileBytes > 0 && s.size > maxFileBytes {
+			fmt.Fprintf(os.Stderr, "warning: %s: %d bytes exceeds --max-file-bytes=%d, excluding from fulltext index\n", s.path, s.size, maxFileBytes)
+			continue
+		}
+		if maxTotalBytes > 0 && totalRead >= maxTotalBytes {
+			if !budgetWarned {
+				fmt.Fprintf(os.Stderr, "warning: --max-total-bytes=%d reached, excluding remaining files from fulltext index\n", maxTotalBytes)
+				budgetWarned = true
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return nil, err
+		}
+		totalRead += int64(len(data))
+		start := buf.Len()
+		buf.Write(data)
+		breaks = append(breaks, docBreak{offset: start, end: buf.Len(), doc: s.path})
+		buf.WriteByte(docSeparator)
+	}
+	content := buf.Bytes()
+	return &fullTextIndex{
+		buf:    content,
+		breaks: breaks,
+		sa:     suffixarray.New(content),
+	}, nil
+}
+
+// hit resolves an absolute offset into the concatenated buffer (plus the
+// length of whatever matched there) into a Hit against the owning doc. It
+// returns ok=false if the match starts before, or runs past the end of,
+// that document's own content, i.e. it spans a docSeparator into another
+// document.
+func (ft *fullTextIndex) hit(offset, matchLen int) (Hit, bool) {
+	// Last break with offset <= offset owns this byte.
+	i := sort.Search(len(ft.breaks), func(i int) bool {
+		return ft.breaks[i].offset > offset
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	b := ft.breaks[i]
+	if offset < b.offset || offset+matchLen > b.end {
+		return Hit{}, false
+	}
+
+	start := offset - snippetRadius
+	if start < b.offset {
+		start = b.offset
+	}
+	end := offset + matchLen + snippetRadius
+	if end > b.end {
+		end = b.end
+	}
+
+	return Hit{
+		Doc:     b.doc,
+		Offset:  offset - b.offset,
+		Snippet: string(ft.buf[start:end]),
+	}, true
+}
+
+// SubstringLookup returns every occurrence of s across the corpus. It
+// requires the engine to have been built with a fulltext index (the
+// --fulltext flag); otherwise it returns nil.
+func (se *SearchEngine) SubstringLookup(s string) []Hit {
+	if se.fullText == nil {
+		return nil
+	}
+	offsets := se.fullText.sa.Lookup([]byte(s), -1)
+	sort.Ints(offsets)
+	hits := make([]Hit, 0, len(offsets))
+	for _, off := range offsets {
+		if h, ok := se.fullText.hit(off, len(s)); ok {
+			hits = append(hits, h)
+		}
+	}
+	return hits
+}
+
+// RegexLookup returns every match of re across the corpus. Like
+// SubstringLookup, it requires a fulltext index and returns nil without
+// one.
+func (se *SearchEngine) RegexLookup(re *regexp.Regexp) []Hit {
+	if se.fullText == nil {
+		return nil
+	}
+	matches := se.fullText.sa.FindAllIndex(re, -1)
+	hits := make([]Hit, 0, len(matches))
+	for _, m := range matches {
+		if h, ok := se.fullText.hit(m[0], m[1]-m[0]); ok {
+			hits = append(hits, h)
+		}
+	}
+	return hits
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// writeTestCorpus writes files to a temp dir and returns an ftSource per
+// file, sorted by path so callers can rely on a deterministic order
+// (map iteration order is randomized).
+func writeTestCorpus(t *testing.T, files map[string]string) []ftSource {
+	t.Helper()
+	dir := t.TempDir()
+	var sources []ftSource
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, ftSource{path: p, size: int64(len(content))})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].path < sources[j].path })
+	return sources
+}
+
+func TestSubstringLookup(t *testing.T) {
+	sources := writeTestCorpus(t, map[string]string{
+		"a.txt": "the quick brown fox",
+		"b.txt": "a lazy dog sleeps",
+	})
+	ft, err := buildFullTextIndex(sources, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &SearchEngine{fullText: ft}
+
+	hits := se.SubstringLookup("fox")
+	if len(hits) != 1 || hits[0].Doc != sources[0].path {
+		t.Fatalf("SubstringLookup(\"fox\") = %+v, want one hit in %s", hits, sources[0].path)
+	}
+}
+
+// TestSubstringLookupDoesNotSpanDocuments locks down the fix for matches
+// straddling two documents in the concatenated buffer: "abc"+"xyz" must
+// not produce a hit for "cxy", which appears nowhere in either document.
+func TestSubstringLookupDoesNotSpanDocuments(t *testing.T) {
+	sources := writeTestCorpus(t, map[string]string{
+		"a.txt": "abc",
+		"b.txt": "xyz",
+	})
+	ft, err := buildFullTextIndex(sources, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &SearchEngine{fullText: ft}
+
+	if hits := se.SubstringLookup("cxy"); len(hits) != 0 {
+		t.Errorf("SubstringLookup(\"cxy\") = %+v, want no hits", hits)
+	}
+	if hits := se.SubstringLookup("abc"); len(hits) != 1 {
+		t.Errorf("SubstringLookup(\"abc\") = %+v, want 1 hit", hits)
+	}
+	if hits := se.SubstringLookup("xyz"); len(hits) != 1 {
+		t.Errorf("SubstringLookup(\"xyz\") = %+v, want 1 hit", hits)
+	}
+}
+
+func TestRegexLookup(t *testing.T) {
+	sources := writeTestCorpus(t, map[string]string{
+		"a.txt": "foo123 bar456",
+	})
+	ft, err := buildFullTextIndex(sources, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &SearchEngine{fullText: ft}
+
+	hits := se.RegexLookup(regexp.MustCompile(`[a-z]+\d+`))
+	if len(hits) != 2 {
+		t.Fatalf("RegexLookup = %+v, want 2 hits", hits)
+	}
+}
+
+// TestRegexLookupDoesNotSpanDocuments is the regex-match analog of
+// TestSubstringLookupDoesNotSpanDocuments: "." matches the docSeparator
+// byte (it isn't a newline), so a greedy pattern could otherwise stitch
+// two documents' content together into one bogus match.
+func TestRegexLookupDoesNotSpanDocuments(t *testing.T) {
+	sources := writeTestCorpus(t, map[string]string{
+		"a.txt": "abc",
+		"b.txt": "xyz",
+	})
+	ft, err := buildFullTextIndex(sources, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &SearchEngine{fullText: ft}
+
+	hits := se.RegexLookup(regexp.MustCompile(`.+`))
+	for _, h := range hits {
+		if h.Doc != sources[0].path && h.Doc != sources[1].path {
+			t.Errorf("unexpected doc in hit %+v", h)
+		}
+	}
+	// Every match must stay within a single 3-byte document.
+	for _, h := range hits {
+		if len(h.Snippet) > 3 {
+			t.Errorf("hit %+v spans more than one document's content", h)
+		}
+	}
+}
+
+func TestBuildFullTextIndexRespectsByteLimits(t *testing.T) {
+	sources := writeTestCorpus(t, map[string]string{
+		"small.txt": "short",
+		"big.txt":   "this one is much longer than the limit",
+	})
+	ft, err := buildFullTextIndex(sources, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &SearchEngine{fullText: ft}
+
+	if hits := se.SubstringLookup("short"); len(hits) != 1 {
+		t.Errorf("SubstringLookup(\"short\") = %+v, want 1 hit", hits)
+	}
+	if hits := se.SubstringLookup("longer"); len(hits) != 0 {
+		t.Errorf("SubstringLookup(\"longer\") = %+v, want 0 hits (big.txt exceeds --max-file-bytes)", hits)
+	}
+}
@@ -1,18 +1,18 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"io/fs"
 	"math"
 	"os"
-	"path/filepath"
-	"regexp"
-	"runtime"
+	"os/signal"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // DocumentIDs represents a set of document identifiers (file paths).
@@ -32,24 +32,80 @@ type SearchEngine struct {
 	totals map[string]int
 	// docs contains all known documents.
 	docs DocumentIDs
+	// meta maps document -> mtime/size, used to detect changed files across runs.
+	// See persist.go.
+	meta map[string]docMeta
+	// positions maps document -> (term -> sorted token positions), used to
+	// resolve phrase queries. See query.go.
+	positions map[string]map[string][]int
+	// analyzer tokenizes and normalizes both document text and query terms.
+	// See analyzer.go.
+	analyzer Analyzer
+	// scorer ranks (term, doc) pairs for RelevanceLookup and query scoring.
+	// See scorer.go.
+	scorer Scorer
+	// fullText is an optional suffix-array index for substring/regex
+	// search, built only when --fulltext is passed. See fulltext.go.
+	fullText *fullTextIndex
 }
 
-func NewSearchEngine() *SearchEngine {
-	return &SearchEngine{
-		index:  make(map[string]DocumentIDs),
-		counts: make(map[string]map[string]int),
-		totals: make(map[string]int),
-		docs:   make(DocumentIDs),
+// Option configures a SearchEngine at construction time.
+type Option func(*SearchEngine)
+
+// WithAnalyzer sets the Analyzer used to tokenize documents and query
+// terms. The default, if this option isn't given, is NewNoneAnalyzer().
+func WithAnalyzer(a Analyzer) Option {
+	return func(se *SearchEngine) { se.analyzer = a }
+}
+
+// WithScorer sets the Scorer used to rank matches. The default, if this
+// option isn't given, is TfIdfScorer{}. Scorers like BM25Scorer need
+// corpus-wide stats (e.g. average document length) that are only known
+// once indexing has finished, so prefer SetScorer over this option when
+// building the index incrementally.
+func WithScorer(s Scorer) Option {
+	return func(se *SearchEngine) { se.scorer = s }
+}
+
+// SetScorer replaces se's Scorer after construction, e.g. once indexing
+// has finished and a BM25Scorer's avgdl can be computed.
+func (se *SearchEngine) SetScorer(s Scorer) {
+	se.scorer = s
+}
+
+func NewSearchEngine(opts ...Option) *SearchEngine {
+	se := &SearchEngine{
+		index:     make(map[string]DocumentIDs),
+		counts:    make(map[string]map[string]int),
+		totals:    make(map[string]int),
+		docs:      make(DocumentIDs),
+		meta:      make(map[string]docMeta),
+		positions: make(map[string]map[string][]int),
+		analyzer:  NewNoneAnalyzer(),
+		scorer:    TfIdfScorer{},
 	}
+	for _, opt := range opts {
+		opt(se)
+	}
+	return se
+}
+
+// Analyze tokenizes and normalizes text the same way se.analyzer tokenizes
+// documents, so query terms match what was indexed (e.g. after stemming).
+func (se *SearchEngine) Analyze(text string) []string {
+	return se.analyzer.Tokenize(strings.NewReader(text))
 }
 
-// AddDocument adds (or replaces) a document in the engine.
+// AddDocument adds (or replaces) a document in the engine. positions maps
+// term -> the (ascending) token positions at which it occurs in docID; it
+// may be nil if phrase queries aren't needed for this document.
 //
 // indexer.go: AddDocument is only called by the reducer goroutine.
-func (se *SearchEngine) AddDocument(docID string, freq map[string]int, totalTerms int) {
+func (se *SearchEngine) AddDocument(docID string, freq map[string]int, totalTerms int, positions map[string][]int) {
 	se.docs[docID] = struct{}{}
 	se.counts[docID] = freq
 	se.totals[docID] = totalTerms
+	se.positions[docID] = positions
 
 	for term := range freq {
 		set, ok := se.index[term]
@@ -113,15 +169,16 @@ type relevanceResult struct {
 	score float64
 }
 
-// RelevanceLookup returns all documents containing term, sorted from highest
-// tf-idf to lowest, with doc path as a deterministic tie-breaker.
+// RelevanceLookup returns all documents containing term, scored by se's
+// Scorer (TfIdfScorer by default) from highest to lowest, with doc path
+// as a deterministic tie-breaker.
 func (se *SearchEngine) RelevanceLookup(term string) []relevanceResult {
 	docs := se.IndexLookup(term)
 	out := make([]relevanceResult, 0, len(docs))
 	for _, docID := range docs {
 		out = append(out, relevanceResult{
 			doc:   docID,
-			score: se.TfIdf(term, docID),
+			score: se.scorer.Score(se, term, docID),
 		})
 	}
 	sort.Slice(out, func(i, j int) bool {
@@ -133,92 +190,16 @@ func (se *SearchEngine) RelevanceLookup(term string) []relevanceResult {
 	return out
 }
 
-// mapResult is the output of the map phase for a single file.
+// mapResult is the output of the tokenize stage for a single file. See
+// pipeline.go.
 type mapResult struct {
-	path  string
-	freq  map[string]int
-	total int
-	err   error
-}
-
-// tokenizeRegex extracts "terms" from text. It keeps internal apostrophes,
-// e.g. o'er or o’er becomes one term. Unicode apostrophe (’) is supported.
-var tokenizeRegex = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’][\p{L}\p{N}]+)*`)
-
-// mapFile reads a file and returns its word-frequency map and total term count.
-func mapFile(path string) (map[string]int, int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer f.Close()
-
-	freq := make(map[string]int)
-	total := 0
-
-	scanner := bufio.NewScanner(f)
-	// Some Shakespeare lines can be long; increase buffer to avoid token too long.
-	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		terms := tokenizeRegex.FindAllString(line, -1)
-		for _, t := range terms {
-			term := strings.ToLower(t)
-			freq[term]++
-			total++
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, 0, err
-	}
-	return freq, total, nil
-}
-
-// walkFiles recursively lists all regular files under root.
-func walkFiles(root string) ([]string, error) {
-	var files []string
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		info, ierr := d.Info()
-		if ierr != nil {
-			return ierr
-		}
-		if !info.Mode().IsRegular() {
-			return nil
-		}
-		files = append(files, path)
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	return files, nil
-}
-
-// worker reads file paths from jobs, maps each file, and sends results.
-func worker(jobs <-chan string, results chan<- mapResult) {
-	for path := range jobs {
-		freq, total, err := mapFile(path)
-		results <- mapResult{path: path, freq: freq, total: total, err: err}
-	}
-}
-
-func chooseWorkerCount(numFiles int) int {
-	// Limit file descriptors by limiting concurrent open files.
-	// Pick something "high enough" for parallelism but bounded.
-	// - runtime.NumCPU()*4 keep CPU busy even with IO stalls.
-	// - cap at 32 to avoid exhausting file descriptors on typical systems.
-	workers := runtime.NumCPU() * 4
-	workers = max(workers, 4)
-	workers = min(workers, 32)
-	workers = min(workers, max(1, numFiles))
-	return workers
+	path      string
+	freq      map[string]int
+	total     int
+	positions map[string][]int
+	modTime   time.Time
+	size      int64
+	err       error
 }
 
 func fatalf(format string, args ...any) {
@@ -227,10 +208,26 @@ func fatalf(format string, args ...any) {
 }
 
 func main() {
-	if len(os.Args) != 2 {
-		fatalf("usage: go run indexer.go ${DIRECTORY}")
+	indexPath := flag.String("index", "", "path to a persistent index shard; if set, loads it and only re-maps changed/new files, then saves it back")
+	analyzerName := flag.String("analyzer", "none", "tokenizer pipeline: none (lowercase only, default), en, or ru")
+	rankerName := flag.String("ranker", "tfidf", "relevance ranker: tfidf (default) or bm25")
+	fullText := flag.Bool("fulltext", false, "also build an in-memory suffix-array index for /regex/ and substring search (uses ~4-8x corpus size memory)")
+	maxFileBytes := flag.Int64("max-file-bytes", 0, "skip any file larger than this many bytes (0 = unlimited)")
+	maxTotalBytes := flag.Int64("max-total-bytes", 0, "stop reading new file content once this many corpus bytes have been read (0 = unlimited)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [--index=path] [--analyzer=en|ru|none] [--ranker=tfidf|bm25] [--fulltext] [--max-file-bytes=N] [--max-total-bytes=N] DIRECTORY\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	root := flag.Arg(0)
+	analyzer, err := AnalyzerByName(*analyzerName)
+	if err != nil {
+		fatalf("error: %v", err)
 	}
-	root := os.Args[1]
 	st, err := os.Stat(root)
 	if err != nil {
 		fatalf("error: %v", err)
@@ -239,65 +236,102 @@ func main() {
 		fatalf("error: %s is not a directory", root)
 	}
 
-	paths, err := walkFiles(root)
-	if err != nil {
-		fatalf("error while scanning directory: %v", err)
-	}
-
-	se := NewSearchEngine()
-	if len(paths) > 0 {
-		workers := chooseWorkerCount(len(paths))
-		jobs := make(chan string)
-		results := make(chan mapResult, workers)
+	// Cancel the whole pipeline cleanly on SIGINT/SIGTERM instead of
+	// leaving partially-indexed state or dangling goroutines.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		for i := 0; i < workers; i++ {
-			go worker(jobs, results)
+	se := NewSearchEngine(WithAnalyzer(analyzer))
+	if *indexPath != "" {
+		loaded, err := LoadIndex(*indexPath, analyzer)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fatalf("error loading index %s: %v", *indexPath, err)
 		}
+		if loaded != nil {
+			se = loaded
+		}
+	}
 
-		// Feed jobs.
-		go func() {
-			for _, p := range paths {
-				jobs <- p
+	// file discovery, IO and tokenization run as a bounded streaming
+	// pipeline: walking emits paths as it goes, an IO-concurrency-limited
+	// stage reads file content (enforcing the byte limits below), and a
+	// separate CPU-concurrency-limited stage tokenizes it. Only the final
+	// reduce step (AddDocument) runs on this, the single reducer,
+	// goroutine. The discovery goroutine below runs concurrently with the
+	// reducer, so it compares against a frozen snapshot of se's meta
+	// instead of se.meta itself, which the reducer is mutating. See
+	// pipeline.go.
+	metaSnapshot := se.SnapshotMeta()
+	onDisk := make(map[string]int64) // path -> size, so the fulltext stage can apply the same byte limits below
+	toIndex := make(chan fileJob)
+	go func() {
+		defer close(toIndex)
+		for job := range walkFilesC(ctx, root) {
+			onDisk[job.path] = job.size
+			if needsReindex(metaSnapshot, job.path, job.modTime, job.size) {
+				select {
+				case toIndex <- job:
+				case <-ctx.Done():
+					return
+				}
 			}
-			close(jobs)
-		}()
+		}
+	}()
 
-		// Reduce results (single goroutine: the main goroutine).
-		for range paths {
-			res := <-results
-			if res.err != nil {
-				// Handle worker error: report and skip document.
-				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", res.path, res.err)
-				continue
-			}
-			se.AddDocument(res.path, res.freq, res.total)
+	raw := readStage(ctx, toIndex, ioConcurrency(), *maxFileBytes, *maxTotalBytes)
+	results := tokenizeStage(raw, cpuConcurrency(), analyzer)
+
+	for res := range results {
+		if res.err != nil {
+			// Handle worker error: report and skip document.
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", res.path, res.err)
+			continue
 		}
+		se.AddDocument(res.path, res.freq, res.total, res.positions)
+		se.SetMeta(res.path, res.modTime, res.size)
 	}
 
-	// Read terms from stdin and answer queries.
-	if err := runQueries(os.Stdin, os.Stdout, se); err != nil {
-		if !errors.Is(err, io.EOF) {
-			fatalf("error: %v", err)
+	// Documents that used to exist but weren't seen by this walk (and
+	// weren't cut short by cancellation) have been deleted; drop them.
+	if ctx.Err() == nil {
+		for docID := range se.docs {
+			if _, ok := onDisk[docID]; !ok {
+				se.RemoveDocument(docID)
+			}
 		}
 	}
-}
 
-func runQueries(r io.Reader, w io.Writer, se *SearchEngine) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		term := strings.ToLower(strings.TrimSpace(scanner.Text()))
-		if term == "" {
-			continue
+	// Built once indexing (and eviction) is finished, since BM25 needs
+	// corpus-wide stats like average document length.
+	scorer, err := ScorerByName(*rankerName, se)
+	if err != nil {
+		fatalf("error: %v", err)
+	}
+	se.SetScorer(scorer)
+
+	if *fullText {
+		sources := make([]ftSource, 0, len(onDisk))
+		for p, size := range onDisk {
+			sources = append(sources, ftSource{path: p, size: size})
 		}
+		sort.Slice(sources, func(i, j int) bool { return sources[i].path < sources[j].path })
+		ft, err := buildFullTextIndex(sources, *maxFileBytes, *maxTotalBytes)
+		if err != nil {
+			fatalf("error building fulltext index: %v", err)
+		}
+		se.fullText = ft
+	}
 
-		results := se.RelevanceLookup(term)
-		fmt.Fprintf(w, "== %s (%d)\n", term, len(results))
-		for _, rr := range results {
-			fmt.Fprintf(w, "%s,%.6f\n", rr.doc, rr.score)
+	if *indexPath != "" {
+		if err := se.SaveIndex(*indexPath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to save index %s: %v\n", *indexPath, err)
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+
+	// Read terms from stdin and answer queries.
+	if err := runQueries(os.Stdin, os.Stdout, se); err != nil {
+		if !errors.Is(err, io.EOF) {
+			fatalf("error: %v", err)
+		}
 	}
-	return io.EOF
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"time"
+)
+
+// docMeta records the mtime/size a document had the last time it was
+// indexed, so subsequent runs can skip re-mapping files that haven't
+// changed.
+type docMeta struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// statsSuffix names the file a shard is written to. se.index isn't
+// persisted separately: AddDocument rebuilds it from each docRecord's
+// Counts on load, so a second copy on disk would only double the
+// serialization cost for no benefit.
+const statsSuffix = ".docstats"
+
+// docRecord is the on-disk representation of a single document's stats.
+type docRecord struct {
+	Path      string
+	ModTime   time.Time
+	Size      int64
+	Total     int
+	Counts    map[string]int
+	Positions map[string][]int
+}
+
+// statsShard is the on-disk representation of se.counts/totals/meta/docs.
+type statsShard struct {
+	Docs []docRecord
+}
+
+// NeedsReindex reports whether docID is unknown to se, or known but stale
+// relative to modTime/size.
+func (se *SearchEngine) NeedsReindex(docID string, modTime time.Time, size int64) bool {
+	return needsReindex(se.meta, docID, modTime, size)
+}
+
+func needsReindex(meta map[string]docMeta, docID string, modTime time.Time, size int64) bool {
+	m, ok := meta[docID]
+	if !ok {
+		return true
+	}
+	return !m.ModTime.Equal(modTime) || m.Size != size
+}
+
+// SnapshotMeta copies se's mtime/size bookkeeping. Use this to compare
+// against from a goroutine that runs concurrently with se's reducer
+// goroutine (e.g. the streaming pipeline's discovery stage in
+// pipeline.go) instead of reading se.meta directly, which would race
+// against the reducer's writes.
+func (se *SearchEngine) SnapshotMeta() map[string]docMeta {
+	out := make(map[string]docMeta, len(se.meta))
+	for k, v := range se.meta {
+		out[k] = v
+	}
+	return out
+}
+
+// SetMeta records the mtime/size docID had at indexing time.
+func (se *SearchEngine) SetMeta(docID string, modTime time.Time, size int64) {
+	se.meta[docID] = docMeta{ModTime: modTime, Size: size}
+}
+
+// RemoveDocument evicts docID from the index, counts, totals, meta and
+// docs, including pruning it out of every term's posting list.
+func (se *SearchEngine) RemoveDocument(docID string) {
+	for term := range se.counts[docID] {
+		set, ok := se.index[term]
+		if !ok {
+			continue
+		}
+		delete(set, docID)
+		if len(set) == 0 {
+			delete(se.index, term)
+		}
+	}
+	delete(se.counts, docID)
+	delete(se.totals, docID)
+	delete(se.meta, docID)
+	delete(se.positions, docID)
+	delete(se.docs, docID)
+}
+
+// SaveIndex writes se to path+statsSuffix: per-doc totals, term counts and
+// positions, enough to rebuild se.index and every other field on load. It's
+// written to a temp file and renamed into place so a crash mid-write can't
+// leave a half-written shard behind.
+func (se *SearchEngine) SaveIndex(path string) error {
+	stats := statsShard{Docs: make([]docRecord, 0, len(se.docs))}
+	for docID := range se.docs {
+		stats.Docs = append(stats.Docs, docRecord{
+			Path:      docID,
+			ModTime:   se.meta[docID].ModTime,
+			Size:      se.meta[docID].Size,
+			Total:     se.totals[docID],
+			Counts:    se.counts[docID],
+			Positions: se.positions[docID],
+		})
+	}
+	if err := writeGob(path+statsSuffix, stats); err != nil {
+		return fmt.Errorf("writing doc stats: %w", err)
+	}
+	return nil
+}
+
+// LoadIndex reads a shard previously written by SaveIndex. an is the
+// analyzer to use for any subsequent incremental re-indexing; it must
+// match the analyzer the shard was built with, or term lookups will
+// miss. LoadIndex returns an error wrapping fs.ErrNotExist if no shard
+// exists at path yet.
+func LoadIndex(path string, an Analyzer) (*SearchEngine, error) {
+	var stats statsShard
+	if err := readGob(path+statsSuffix, &stats); err != nil {
+		return nil, fmt.Errorf("reading doc stats: %w", err)
+	}
+
+	se := NewSearchEngine(WithAnalyzer(an))
+	for _, rec := range stats.Docs {
+		se.AddDocument(rec.Path, rec.Counts, rec.Total, rec.Positions)
+		se.SetMeta(rec.Path, rec.ModTime, rec.Size)
+	}
+	return se, nil
+}
+
+func writeGob(path string, v any) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(v); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readGob(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewDecoder(f).Decode(v)
+}
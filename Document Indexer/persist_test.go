@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func buildPersistTestEngine() *SearchEngine {
+	se := NewSearchEngine()
+	se.AddDocument("a.txt", map[string]int{"fox": 2, "dog": 1}, 3,
+		map[string][]int{"fox": {0, 2}, "dog": {1}})
+	se.SetMeta("a.txt", time.Unix(1000, 0), 12)
+	se.AddDocument("b.txt", map[string]int{"fox": 1, "cat": 1}, 2,
+		map[string][]int{"fox": {0}, "cat": {1}})
+	se.SetMeta("b.txt", time.Unix(2000, 0), 8)
+	return se
+}
+
+// TestSaveLoadRoundTrip verifies every piece of state SaveIndex persists
+// comes back unchanged through LoadIndex: the rebuilt se.index (not
+// persisted directly, but reconstructed by AddDocument from Counts) as
+// well as counts, totals, positions and meta.
+func TestSaveLoadRoundTrip(t *testing.T) {
+	se := buildPersistTestEngine()
+	path := filepath.Join(t.TempDir(), "shard")
+	if err := se.SaveIndex(path); err != nil {
+		t.Fatalf("SaveIndex: %v", err)
+	}
+
+	loaded, err := LoadIndex(path, NewNoneAnalyzer())
+	if err != nil {
+		t.Fatalf("LoadIndex: %v", err)
+	}
+
+	if !reflect.DeepEqual(se.docs, loaded.docs) {
+		t.Errorf("docs = %v, want %v", loaded.docs, se.docs)
+	}
+	if !reflect.DeepEqual(se.counts, loaded.counts) {
+		t.Errorf("counts = %v, want %v", loaded.counts, se.counts)
+	}
+	if !reflect.DeepEqual(se.totals, loaded.totals) {
+		t.Errorf("totals = %v, want %v", loaded.totals, se.totals)
+	}
+	if !reflect.DeepEqual(se.positions, loaded.positions) {
+		t.Errorf("positions = %v, want %v", loaded.positions, se.positions)
+	}
+	if !reflect.DeepEqual(se.meta, loaded.meta) {
+		t.Errorf("meta = %v, want %v", loaded.meta, se.meta)
+	}
+	for term, docs := range se.index {
+		if !reflect.DeepEqual(docs, loaded.index[term]) {
+			t.Errorf("index[%q] = %v, want %v", term, loaded.index[term], docs)
+		}
+	}
+	for term := range loaded.index {
+		if _, ok := se.index[term]; !ok {
+			t.Errorf("loaded.index has unexpected term %q", term)
+		}
+	}
+}
+
+func TestLoadIndexMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist")
+	_, err := LoadIndex(path, NewNoneAnalyzer())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadIndex on missing shard: err = %v, want one wrapping os.ErrNotExist", err)
+	}
+}
+
+func TestLoadIndexCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shard")
+	if err := os.WriteFile(path+statsSuffix, []byte("not a gob stream"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(path, NewNoneAnalyzer()); err == nil {
+		t.Error("LoadIndex on a corrupt shard returned no error")
+	}
+}
+
+// TestNeedsReindexChangedFile exercises the incremental-reindex path: an
+// unknown doc, an unchanged doc and a doc whose mtime or size moved should
+// each be judged independently of each other.
+func TestNeedsReindexChangedFile(t *testing.T) {
+	se := buildPersistTestEngine()
+
+	if se.NeedsReindex("unknown.txt", time.Unix(1, 0), 1) != true {
+		t.Error("NeedsReindex(unknown doc) = false, want true")
+	}
+	if se.NeedsReindex("a.txt", time.Unix(1000, 0), 12) != false {
+		t.Error("NeedsReindex(unchanged doc) = true, want false")
+	}
+	if se.NeedsReindex("a.txt", time.Unix(1001, 0), 12) != true {
+		t.Error("NeedsReindex(changed mtime) = false, want true")
+	}
+	if se.NeedsReindex("a.txt", time.Unix(1000, 0), 13) != true {
+		t.Error("NeedsReindex(changed size) = false, want true")
+	}
+}
+
+// TestRemoveDocumentEviction simulates a document that existed across two
+// runs, was saved, then disappeared from disk: RemoveDocument should
+// fully evict it, including pruning posting lists down to nothing for a
+// term only that doc used, while leaving shared terms and other docs
+// intact. The result is then re-saved and reloaded to make sure eviction
+// sticks across a persist round trip.
+func TestRemoveDocumentEviction(t *testing.T) {
+	se := buildPersistTestEngine()
+
+	se.RemoveDocument("b.txt")
+
+	if _, ok := se.docs["b.txt"]; ok {
+		t.Error("b.txt still in docs after RemoveDocument")
+	}
+	if _, ok := se.meta["b.txt"]; ok {
+		t.Error("b.txt still in meta after RemoveDocument")
+	}
+	if _, ok := se.counts["b.txt"]; ok {
+		t.Error("b.txt still in counts after RemoveDocument")
+	}
+	if _, ok := se.positions["b.txt"]; ok {
+		t.Error("b.txt still in positions after RemoveDocument")
+	}
+	// "cat" only appeared in b.txt, so its posting list should be gone
+	// entirely rather than left behind as an empty set.
+	if _, ok := se.index["cat"]; ok {
+		t.Error("index[\"cat\"] still present after its only doc was removed")
+	}
+	// "fox" is shared with a.txt, so it should survive with just a.txt.
+	if got, want := se.IndexLookup("fox"), []string{"a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexLookup(\"fox\") = %v, want %v", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "shard")
+	if err := se.SaveIndex(path); err != nil {
+		t.Fatalf("SaveIndex: %v", err)
+	}
+	loaded, err := LoadIndex(path, NewNoneAnalyzer())
+	if err != nil {
+		t.Fatalf("LoadIndex: %v", err)
+	}
+	if _, ok := loaded.docs["b.txt"]; ok {
+		t.Error("b.txt reappeared after save/reload following eviction")
+	}
+	if _, ok := loaded.docs["a.txt"]; !ok {
+		t.Error("a.txt missing after save/reload following eviction of b.txt")
+	}
+}
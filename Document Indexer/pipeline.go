@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fileJob is a file discovered by walkFilesC, not yet read.
+type fileJob struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// rawFile is a file's content as read by readStage, not yet tokenized.
+type rawFile struct {
+	path    string
+	content []byte
+	size    int64
+	modTime time.Time
+	err     error
+}
+
+// walkFilesC recursively lists regular files under root, emitting each as
+// it's found rather than building the whole list before any file is
+// processed. It stops (and closes the returned channel) early if ctx is
+// canceled.
+func walkFilesC(ctx context.Context, root string) <-chan fileJob {
+	out := make(chan fileJob)
+	go func() {
+		defer close(out)
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, err)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, err)
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			select {
+			case out <- fileJob{path: path, size: info.Size(), modTime: info.ModTime()}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		})
+	}()
+	return out
+}
+
+// ioConcurrency bounds how many files readStage has open at once. It's
+// sized independently from cpuConcurrency because IO-bound work (waiting
+// on the filesystem) and CPU-bound work (tokenizing) have different
+// sweet spots, and because every concurrent read holds a file descriptor.
+func ioConcurrency() int {
+	n := runtime.NumCPU() * 4
+	n = max(n, 4)
+	n = min(n, 32)
+	return n
+}
+
+// cpuConcurrency bounds how many files tokenizeStage processes at once.
+func cpuConcurrency() int {
+	return max(1, runtime.NumCPU())
+}
+
+// readStage reads the content of every file from jobs, respecting
+// maxFileBytes (skip any single file larger than this, 0 = unlimited) and
+// maxTotalBytes (stop reading once this many corpus bytes have been read,
+// 0 = unlimited). Up to concurrency files are read at once.
+func readStage(ctx context.Context, jobs <-chan fileJob, concurrency int, maxFileBytes, maxTotalBytes int64) <-chan rawFile {
+	out := make(chan rawFile)
+	var totalRead atomic.Int64
+	var budgetWarned atomic.Bool
+
+	go func() {
+		defer close(out)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for job := range jobs {
+			if ctx.Err() != nil {
+				break
+			}
+			if maxFileBytes > 0 && job.size > maxFileBytes {
+				fmt.Fprintf(os.Stderr, "warning: %s: %d bytes exceeds --max-file-bytes=%d, skipping\n", job.path, job.size, maxFileBytes)
+				continue
+			}
+			if maxTotalBytes > 0 && totalRead.Load() >= maxTotalBytes {
+				if !budgetWarned.Swap(true) {
+					fmt.Fprintf(os.Stderr, "warning: --max-total-bytes=%d reached, skipping remaining files\n", maxTotalBytes)
+				}
+				continue
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(job fileJob) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				data, err := os.ReadFile(job.path)
+				if err != nil {
+					select {
+					case out <- rawFile{path: job.path, err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				totalRead.Add(int64(len(data)))
+				select {
+				case out <- rawFile{path: job.path, content: data, size: job.size, modTime: job.modTime}:
+				case <-ctx.Done():
+				}
+			}(job)
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+// tokenizeStage runs an's Tokenize over every file's content from in,
+// producing the frequency map, total term count and positional index
+// mapFile used to build. Up to concurrency files are tokenized at once;
+// this is deliberately a separate concurrency budget from readStage's,
+// since tokenization is CPU-bound rather than IO-bound.
+func tokenizeStage(in <-chan rawFile, concurrency int, an Analyzer) <-chan mapResult {
+	out := make(chan mapResult)
+	go func() {
+		defer close(out)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for rf := range in {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(rf rawFile) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				if rf.err != nil {
+					out <- mapResult{path: rf.path, err: rf.err}
+					return
+				}
+				tokens := an.Tokenize(bytes.NewReader(rf.content))
+				freq := make(map[string]int, len(tokens))
+				positions := make(map[string][]int, len(tokens))
+				for i, term := range tokens {
+					freq[term]++
+					positions[term] = append(positions[term], i)
+				}
+				out <- mapResult{
+					path:      rf.path,
+					freq:      freq,
+					total:     len(tokens),
+					positions: positions,
+					modTime:   rf.modTime,
+					size:      rf.size,
+				}
+			}(rf)
+		}
+		wg.Wait()
+	}()
+	return out
+}
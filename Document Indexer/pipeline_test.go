@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// feedJobs sends jobs on a channel and closes it once all are sent,
+// standing in for walkFilesC when a test needs a fixed, known ordering
+// instead of filesystem walk order.
+func feedJobs(jobs []fileJob) <-chan fileJob {
+	out := make(chan fileJob, len(jobs))
+	for _, j := range jobs {
+		out <- j
+	}
+	close(out)
+	return out
+}
+
+func drainRawFiles(ch <-chan rawFile) []rawFile {
+	var got []rawFile
+	for rf := range ch {
+		got = append(got, rf)
+	}
+	return got
+}
+
+// TestReadStageMaxFileBytes verifies a single oversized file is skipped
+// (with the rest still read), rather than truncated or aborting the run.
+func TestReadStageMaxFileBytes(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	big := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(small, []byte("short"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(big, []byte("this content is far longer than the limit"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := feedJobs([]fileJob{
+		{path: small, size: 5},
+		{path: big, size: 42},
+	})
+	out := readStage(context.Background(), jobs, 1, 10, 0)
+	got := drainRawFiles(out)
+
+	if len(got) != 1 || got[0].path != small {
+		t.Fatalf("readStage with maxFileBytes=10 = %+v, want only %s", got, small)
+	}
+}
+
+// TestReadStageMaxTotalBytes verifies the corpus-wide budget stops
+// admitting further files once it's been reached, without touching files
+// already within budget. Jobs are fed one at a time through an
+// unbuffered channel, waiting for each file's rawFile to come out the
+// other end before sending the next job: readStage updates its running
+// total before emitting a rawFile, so this guarantees the budget check
+// for job N+1 sees job N's bytes, which a buffered/concurrent feed
+// wouldn't.
+func TestReadStageMaxTotalBytes(t *testing.T) {
+	dir := t.TempDir()
+	var jobs []fileJob
+	for i, content := range []string{"aaaaa", "bbbbb", "ccccc"} {
+		p := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, fileJob{path: p, size: int64(len(content))})
+	}
+
+	jobsCh := make(chan fileJob)
+	out := readStage(context.Background(), jobsCh, 1, 0, 5)
+
+	jobsCh <- jobs[0]
+	first := <-out
+	jobsCh <- jobs[1]
+	jobsCh <- jobs[2]
+	close(jobsCh)
+	got := append([]rawFile{first}, drainRawFiles(out)...)
+
+	if len(got) != 1 || got[0].path != jobs[0].path {
+		t.Fatalf("readStage with maxTotalBytes=5 = %+v, want only %s", got, jobs[0].path)
+	}
+}
+
+// TestPipelineCancellationNoLeak cancels the context mid-stream and
+// verifies the full walkFilesC -> readStage -> tokenizeStage chain drains
+// to completion (no partial/garbage results reach tokenizeStage's
+// output, since every rawFile it sees came from a real, fully-read file)
+// and leaves no goroutines behind once the channels are closed.
+func TestPipelineCancellationNoLeak(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		p := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(p, []byte("some file content to tokenize"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settleGoroutines := func() int {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		return runtime.NumGoroutine()
+	}
+	before := settleGoroutines()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := walkFilesC(ctx, dir)
+	rawFiles := readStage(ctx, jobs, ioConcurrency(), 0, 0)
+	results := tokenizeStage(rawFiles, cpuConcurrency(), NewNoneAnalyzer())
+
+	// Cancel almost immediately so the walk is very likely still in
+	// flight, then drain every stage fully to completion: a well-behaved
+	// pipeline must still close all channels promptly rather than hang.
+	cancel()
+	var got []mapResult
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range results {
+			got = append(got, r)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not drain after context cancellation; suspect a goroutine deadlock")
+	}
+
+	for _, r := range got {
+		if r.err != nil {
+			continue
+		}
+		if r.path == "" || r.freq == nil {
+			t.Errorf("mapResult %+v looks like a partial/garbage result", r)
+		}
+	}
+
+	after := settleGoroutines()
+	if after > before {
+		t.Errorf("goroutine count after canceled pipeline = %d, want <= %d (baseline)", after, before)
+	}
+}
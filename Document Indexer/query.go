@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// runQueries reads one query per line from r and writes matching documents
+// to w. A query wrapped in slashes, e.g. /fo+/, is a regex run against the
+// --fulltext suffix-array index (see fulltext.go). Anything else is parsed
+// as a boolean/phrase query: AND, OR, NOT, parenthesized groups and
+// "quoted phrases" over the single-term queries the index understands;
+// see parseQuery for the grammar. Each result line is scored by summing
+// se's Scorer over every term the query matched, same as a plain term
+// lookup.
+func runQueries(r io.Reader, w io.Writer, se *SearchEngine) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		query := strings.TrimSpace(scanner.Text())
+		if query == "" {
+			continue
+		}
+
+		if len(query) >= 2 && strings.HasPrefix(query, "/") && strings.HasSuffix(query, "/") {
+			runRegexQuery(w, se, query)
+			continue
+		}
+
+		expr, err := parseQuery(query)
+		if err != nil {
+			fmt.Fprintf(w, "== %s (error: %v)\n", query, err)
+			continue
+		}
+
+		docs, terms := expr.eval(se)
+		results := scoreDocs(se, docs, terms)
+		fmt.Fprintf(w, "== %s (%d)\n", query, len(results))
+		for _, rr := range results {
+			fmt.Fprintf(w, "%s,%.6f\n", rr.doc, rr.score)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// runRegexQuery handles a /pattern/ query against se's fulltext index.
+func runRegexQuery(w io.Writer, se *SearchEngine, query string) {
+	pattern := query[1 : len(query)-1]
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(w, "== %s (error: %v)\n", query, err)
+		return
+	}
+	if se.fullText == nil {
+		fmt.Fprintf(w, "== %s (error: fulltext index not built; rerun with --fulltext)\n", query)
+		return
+	}
+	hits := se.RegexLookup(re)
+	fmt.Fprintf(w, "== %s (%d)\n", query, len(hits))
+	for _, h := range hits {
+		fmt.Fprintf(w, "%s:%d: %s\n", h.Doc, h.Offset, h.Snippet)
+	}
+}
+
+// scoreDocs ranks docs by the sum of se's Scorer over terms, highest
+// first, with doc path as a deterministic tie-breaker.
+func scoreDocs(se *SearchEngine, docs DocumentIDs, terms []string) []relevanceResult {
+	out := make([]relevanceResult, 0, len(docs))
+	for doc := range docs {
+		var score float64
+		for _, t := range terms {
+			score += se.scorer.Score(se, t, doc)
+		}
+		out = append(out, relevanceResult{doc: doc, score: score})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score == out[j].score {
+			return out[i].doc < out[j].doc
+		}
+		return out[i].score > out[j].score
+	})
+	return out
+}
+
+// PhraseMatches returns the documents in which words occur consecutively,
+// i.e. there is some position p such that words[i] occurs at position
+// p+i for every i.
+func (se *SearchEngine) PhraseMatches(words []string) DocumentIDs {
+	out := make(DocumentIDs)
+	if len(words) == 0 {
+		return out
+	}
+	for doc := range se.IndexSet(words[0]) {
+		starts := se.positions[doc][words[0]]
+	nextStart:
+		for _, p := range starts {
+			for i := 1; i < len(words); i++ {
+				if !hasPosition(se.positions[doc][words[i]], p+i) {
+					continue nextStart
+				}
+			}
+			out[doc] = struct{}{}
+			break
+		}
+	}
+	return out
+}
+
+// hasPosition reports whether the sorted slice positions contains p.
+func hasPosition(positions []int, p int) bool {
+	i := sort.SearchInts(positions, p)
+	return i < len(positions) && positions[i] == p
+}
+
+// IndexSet is IndexLookup without the slice copy, for internal callers
+// that only need set membership (e.g. query evaluation).
+func (se *SearchEngine) IndexSet(term string) DocumentIDs {
+	return se.index[term]
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryExpr is a node in a parsed boolean/phrase query.
+//
+// eval returns the set of matching documents and the list of terms that
+// contributed to the match, which runQueries uses to compute a tf-idf
+// score (summed over those terms) for every matching document.
+type queryExpr interface {
+	eval(se *SearchEngine) (DocumentIDs, []string)
+}
+
+// termExpr holds a raw query word; eval runs it through se's analyzer so
+// e.g. a stemming analyzer matches "running" against an indexed "run". The
+// analyzer can split a single bare word into more than one term (e.g. a
+// hyphenated word like "well-known", since the tokenizer doesn't treat
+// "-" as part of a word); when it does, eval falls back to a phrase match
+// over all of them, the same as if the word had been quoted, instead of
+// silently keeping only the first term.
+type termExpr struct{ word string }
+
+func (t termExpr) eval(se *SearchEngine) (DocumentIDs, []string) {
+	terms := se.Analyze(t.word)
+	switch len(terms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return se.IndexSet(terms[0]), terms
+	default:
+		return se.PhraseMatches(terms), terms
+	}
+}
+
+// phraseExpr holds the raw text between quotes; eval analyzes it as a
+// whole so stop-word removal/stemming line up with how it was indexed.
+type phraseExpr struct{ text string }
+
+func (p phraseExpr) eval(se *SearchEngine) (DocumentIDs, []string) {
+	words := se.Analyze(p.text)
+	return se.PhraseMatches(words), words
+}
+
+type notExpr struct{ inner queryExpr }
+
+func (n notExpr) eval(se *SearchEngine) (DocumentIDs, []string) {
+	inner, _ := n.inner.eval(se)
+	out := make(DocumentIDs, len(se.docs))
+	for doc := range se.docs {
+		if _, ok := inner[doc]; !ok {
+			out[doc] = struct{}{}
+		}
+	}
+	// NOT terms don't contribute to the score of the docs they leave in.
+	return out, nil
+}
+
+type andExpr struct{ left, right queryExpr }
+
+func (a andExpr) eval(se *SearchEngine) (DocumentIDs, []string) {
+	left, lt := a.left.eval(se)
+	right, rt := a.right.eval(se)
+	small, big := left, right
+	if len(big) < len(small) {
+		small, big = big, small
+	}
+	out := make(DocumentIDs, len(small))
+	for doc := range small {
+		if _, ok := big[doc]; ok {
+			out[doc] = struct{}{}
+		}
+	}
+	return out, append(append([]string{}, lt...), rt...)
+}
+
+type orExpr struct{ left, right queryExpr }
+
+func (o orExpr) eval(se *SearchEngine) (DocumentIDs, []string) {
+	left, lt := o.left.eval(se)
+	right, rt := o.right.eval(se)
+	out := make(DocumentIDs, len(left)+len(right))
+	for doc := range left {
+		out[doc] = struct{}{}
+	}
+	for doc := range right {
+		out[doc] = struct{}{}
+	}
+	return out, append(append([]string{}, lt...), rt...)
+}
+
+// parseQuery parses a query string into a queryExpr tree. Grammar
+// (NOT binds tighter than AND, which binds tighter than OR):
+//
+//	expr   := and (OR and)*
+//	and    := not (AND not)*
+//	not    := NOT not | atom
+//	atom   := '(' expr ')' | WORD | "quoted phrase"
+//
+// Bare terms are lowercased to match the index, which is built from
+// lowercased tokens.
+func parseQuery(q string) (queryExpr, error) {
+	toks, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected token %q", p.toks[p.pos].text)
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lexQuery(q string) ([]token, error) {
+	var toks []token
+	runes := []rune(q)
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated phrase starting at %d", i)
+			}
+			toks = append(toks, token{kind: tokPhrase, text: string(runes[i+1 : j])})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && runes[j] != ' ' && runes[j] != '\t' && runes[j] != '(' && runes[j] != ')' && runes[j] != '"' {
+				j++
+			}
+			word := string(runes[i:j])
+			switch strings.ToUpper(word) {
+			case "AND":
+				toks = append(toks, token{kind: tokAnd})
+			case "OR":
+				toks = append(toks, token{kind: tokOr})
+			case "NOT":
+				toks = append(toks, token{kind: tokNot})
+			default:
+				toks = append(toks, token{kind: tokWord, text: word})
+			}
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+type queryParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *queryParser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokOr {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokAnd {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	tok, ok := p.peek()
+	if ok && tok.kind == tokNot {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner: inner}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (queryExpr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch tok.kind {
+	case tokLParen:
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.peek()
+		if !ok || closing.kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	case tokWord:
+		p.pos++
+		return termExpr{word: tok.text}, nil
+	case tokPhrase:
+		p.pos++
+		return phraseExpr{text: tok.text}, nil
+	default:
+		return nil, fmt.Errorf("unexpected token %q", tok.text)
+	}
+}
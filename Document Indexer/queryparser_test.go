@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+// buildParserTestEngine indexes a handful of documents with distinct,
+// overlapping terms so AND/OR/NOT/phrase queries have something to chew on.
+func buildParserTestEngine() *SearchEngine {
+	se := NewSearchEngine()
+	se.AddDocument("doc1.txt", map[string]int{"quick": 1, "brown": 1, "fox": 1}, 3,
+		map[string][]int{"quick": {0}, "brown": {1}, "fox": {2}})
+	se.AddDocument("doc2.txt", map[string]int{"quick": 1, "fox": 1}, 2,
+		map[string][]int{"quick": {0}, "fox": {1}})
+	se.AddDocument("doc3.txt", map[string]int{"lazy": 1, "dog": 1}, 2,
+		map[string][]int{"lazy": {0}, "dog": {1}})
+	se.AddDocument("doc4.txt", map[string]int{"well": 1, "unrelated": 1}, 2,
+		map[string][]int{"well": {0}, "unrelated": {1}})
+	se.AddDocument("doc5.txt", map[string]int{"well": 1, "known": 1}, 2,
+		map[string][]int{"well": {0}, "known": {1}})
+	return se
+}
+
+func evalDocs(t *testing.T, se *SearchEngine, query string) map[string]bool {
+	t.Helper()
+	expr, err := parseQuery(query)
+	if err != nil {
+		t.Fatalf("parseQuery(%q): %v", query, err)
+	}
+	docs, _ := expr.eval(se)
+	out := make(map[string]bool, len(docs))
+	for d := range docs {
+		out[d] = true
+	}
+	return out
+}
+
+func TestParseQueryBoolean(t *testing.T) {
+	se := buildParserTestEngine()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"fox", []string{"doc1.txt", "doc2.txt"}},
+		{"fox AND quick", []string{"doc1.txt", "doc2.txt"}},
+		{"fox AND brown", []string{"doc1.txt"}},
+		{"fox OR dog", []string{"doc1.txt", "doc2.txt", "doc3.txt"}},
+		{"NOT fox", []string{"doc3.txt", "doc4.txt", "doc5.txt"}},
+		{"(fox OR dog) AND NOT brown", []string{"doc2.txt", "doc3.txt"}},
+		{`"quick brown fox"`, []string{"doc1.txt"}},
+		{`"brown quick"`, nil},
+	}
+	for _, tt := range tests {
+		got := evalDocs(t, se, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("query %q: got %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for _, w := range tt.want {
+			if !got[w] {
+				t.Errorf("query %q: got %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestParseQueryHyphenatedWord locks down the fix for a bare word that the
+// analyzer splits into more than one term (tokenizeRegex doesn't treat "-"
+// as part of a word): it must behave like the equivalent quoted phrase,
+// not silently match on only the first term.
+func TestParseQueryHyphenatedWord(t *testing.T) {
+	se := buildParserTestEngine()
+	got := evalDocs(t, se, "well-known")
+	want := evalDocs(t, se, `"well known"`)
+	if len(got) != 1 || !got["doc5.txt"] {
+		t.Fatalf(`evalDocs("well-known") = %v, want {doc5.txt: true}`, got)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("well-known matched %v, quoted phrase matched %v, want the same", got, want)
+	}
+	for d := range want {
+		if !got[d] {
+			t.Errorf("well-known missing %s that the quoted phrase matched", d)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, q := range []string{
+		`"unterminated`,
+		`(fox`,
+		`AND fox`,
+		`fox )`,
+	} {
+		if _, err := parseQuery(q); err == nil {
+			t.Errorf("parseQuery(%q) returned no error", q)
+		}
+	}
+}
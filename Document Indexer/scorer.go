@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scorer ranks how relevant docID is to term. SearchEngine.RelevanceLookup
+// and query scoring both go through se.scorer, so swapping the Scorer
+// changes ranking without touching lookup or query-parsing code.
+type Scorer interface {
+	Score(se *SearchEngine, term, docID string) float64
+}
+
+// TfIdfScorer is the engine's original ranking function: tf(t,d) * idf(t,D).
+type TfIdfScorer struct{}
+
+func (TfIdfScorer) Score(se *SearchEngine, term, docID string) float64 {
+	return se.TfIdf(term, docID)
+}
+
+// BM25Scorer implements Okapi BM25:
+//
+//	score(t,d) = idf(t) * (f(t,d)*(k1+1)) / (f(t,d) + k1*(1 - b + b*|d|/avgdl))
+//	idf(t)     = log((N - n_t + 0.5)/(n_t + 0.5) + 1)
+//
+// Unlike TfIdfScorer, BM25 uses the raw term count f(t,d) rather than a
+// length-normalized tf, folding document-length normalization into the
+// denominator instead (via b and avgdl).
+type BM25Scorer struct {
+	K1    float64
+	B     float64
+	avgDL float64
+}
+
+// NewBM25Scorer builds a BM25Scorer with the usual defaults (k1=1.2,
+// b=0.75) and avgdl computed from se.totals. Call it after indexing has
+// finished: avgdl baked in at construction time would go stale as
+// documents are added or removed.
+func NewBM25Scorer(se *SearchEngine) *BM25Scorer {
+	return &BM25Scorer{K1: 1.2, B: 0.75, avgDL: averageDocLength(se)}
+}
+
+func averageDocLength(se *SearchEngine) float64 {
+	if len(se.totals) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, total := range se.totals {
+		sum += total
+	}
+	return float64(sum) / float64(len(se.totals))
+}
+
+func (s *BM25Scorer) Score(se *SearchEngine, term, docID string) float64 {
+	N := len(se.docs)
+	nt := len(se.index[term])
+	if N == 0 || nt == 0 {
+		return 0
+	}
+	idf := math.Log((float64(N)-float64(nt)+0.5)/(float64(nt)+0.5) + 1)
+
+	f := float64(se.counts[docID][term])
+	avgDL := s.avgDL
+	if avgDL == 0 {
+		avgDL = 1
+	}
+	dl := float64(se.totals[docID])
+
+	denom := f + s.K1*(1-s.B+s.B*dl/avgDL)
+	if denom == 0 {
+		return 0
+	}
+	return idf * (f * (s.K1 + 1)) / denom
+}
+
+// ScorerByName resolves the --ranker flag value to a Scorer. BM25
+// requires se's stats, so it must be built once indexing is finished.
+func ScorerByName(name string, se *SearchEngine) (Scorer, error) {
+	switch name {
+	case "", "tfidf":
+		return TfIdfScorer{}, nil
+	case "bm25":
+		return NewBM25Scorer(se), nil
+	default:
+		return nil, fmt.Errorf("unknown ranker %q (want tfidf or bm25)", name)
+	}
+}
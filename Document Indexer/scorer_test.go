@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+// buildScorerTestEngine returns an engine with three documents of very
+// different lengths that all mention "fox" once, so length normalization
+// (or the lack of it) is the only thing that can move the ranking, plus a
+// handful of filler documents without "fox" so idf(fox) stays positive.
+func buildScorerTestEngine() *SearchEngine {
+	se := NewSearchEngine()
+	se.AddDocument("short.txt", map[string]int{"fox": 1}, 2, nil)
+	se.AddDocument("medium.txt", map[string]int{"fox": 1}, 20, nil)
+	se.AddDocument("long.txt", map[string]int{"fox": 1}, 200, nil)
+	for i, filler := range []string{"other.txt", "more.txt", "misc.txt", "misc2.txt", "misc3.txt"} {
+		se.AddDocument(filler, map[string]int{"dog": 1}, 10+i, nil)
+	}
+	return se
+}
+
+// TestBM25PenalizesLongerDocuments checks the ranker-quality difference the
+// BM25Scorer exists for: among documents with an identical raw term count,
+// tf-idf (which divides by document length) should rank the shortest
+// document highest, and BM25's length normalization (via b/avgdl) should
+// agree, unlike an unnormalized raw count would.
+func TestBM25PenalizesLongerDocuments(t *testing.T) {
+	se := buildScorerTestEngine()
+	bm25 := NewBM25Scorer(se)
+
+	for _, scorer := range []Scorer{TfIdfScorer{}, bm25} {
+		se.SetScorer(scorer)
+		results := se.RelevanceLookup("fox")
+		if len(results) != 3 {
+			t.Fatalf("RelevanceLookup(\"fox\") returned %d results, want 3", len(results))
+		}
+		if results[0].doc != "short.txt" {
+			t.Errorf("%T: top result = %s, want short.txt (got order %v)", scorer, results[0].doc, results)
+		}
+		if results[len(results)-1].doc != "long.txt" {
+			t.Errorf("%T: bottom result = %s, want long.txt (got order %v)", scorer, results[len(results)-1].doc, results)
+		}
+	}
+}
+
+func TestScorerByName(t *testing.T) {
+	se := buildScorerTestEngine()
+	if _, err := ScorerByName("bogus", se); err == nil {
+		t.Error("ScorerByName(\"bogus\") returned no error, want one")
+	}
+	if s, err := ScorerByName("", se); err != nil || s != (TfIdfScorer{}) {
+		t.Errorf("ScorerByName(\"\") = %v, %v, want TfIdfScorer{}, nil", s, err)
+	}
+	if s, err := ScorerByName("bm25", se); err != nil {
+		t.Errorf("ScorerByName(\"bm25\") returned error: %v", err)
+	} else if _, ok := s.(*BM25Scorer); !ok {
+		t.Errorf("ScorerByName(\"bm25\") = %T, want *BM25Scorer", s)
+	}
+}
+
+// BenchmarkTfIdfScorer and BenchmarkBM25Scorer compare the two rankers'
+// Score cost over the same corpus and query term.
+func BenchmarkTfIdfScorer(b *testing.B) {
+	se := buildScorerTestEngine()
+	se.SetScorer(TfIdfScorer{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		se.scorer.Score(se, "fox", "medium.txt")
+	}
+}
+
+func BenchmarkBM25Scorer(b *testing.B) {
+	se := buildScorerTestEngine()
+	se.SetScorer(NewBM25Scorer(se))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		se.scorer.Score(se, "fox", "medium.txt")
+	}
+}
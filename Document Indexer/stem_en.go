@@ -0,0 +1,81 @@
+package main
+
+import "strings"
+
+// stemEnglish is a simplified Porter stemmer: it strips the most common
+// English inflectional and derivational suffixes, but (unlike the full
+// Porter algorithm) skips the vowel-consonant-measure gating rules, so it
+// over-stems a few irregular words. That's an acceptable trade-off for a
+// search index, where the goal is to group obvious variants (e.g.
+// "running"/"runs"/"run") rather than produce linguistically exact stems.
+func stemEnglish(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+
+	// Step 1a: plurals.
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"):
+		// leave as-is
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "us"):
+		word = word[:len(word)-1]
+	}
+
+	// Step 1b: verb endings.
+	switch {
+	case strings.HasSuffix(word, "eed"):
+		if len(word) > 4 {
+			word = word[:len(word)-1]
+		}
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		word = restoreAfterStrip(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		word = restoreAfterStrip(word[:len(word)-2])
+	}
+
+	// Step 2: common derivational suffixes, longest first.
+	derivational := []struct{ suffix, replacement string }{
+		{"ational", "ate"}, {"tional", "tion"}, {"iveness", "ive"},
+		{"fulness", "ful"}, {"ousness", "ous"}, {"biliti", "ble"},
+		{"alism", "al"}, {"aliti", "al"}, {"iviti", "ive"},
+		{"enci", "ence"}, {"anci", "ance"}, {"izer", "ize"},
+		{"ator", "ate"}, {"icate", "ic"}, {"ative", ""},
+		{"alize", "al"}, {"iciti", "ic"}, {"ical", "ic"},
+		{"ness", ""}, {"ful", ""},
+	}
+	for _, d := range derivational {
+		if strings.HasSuffix(word, d.suffix) && len(word) > len(d.suffix)+2 {
+			word = word[:len(word)-len(d.suffix)] + d.replacement
+			break
+		}
+	}
+
+	return word
+}
+
+// restoreAfterStrip undoes double-consonant endings left behind by
+// stripping "ing"/"ed" (e.g. "hopp" -> "hop"), and restores a trailing
+// "e" for short stems that clearly need one (e.g. "hop" from "hoped"
+// is left alone, but "mak" from "making" becomes "make").
+func restoreAfterStrip(stem string) string {
+	if len(stem) >= 2 {
+		last, prev := stem[len(stem)-1], stem[len(stem)-2]
+		if last == prev && isConsonant(last) && last != 'l' && last != 's' && last != 'z' {
+			return stem[:len(stem)-1]
+		}
+	}
+	return stem
+}
+
+func isConsonant(b byte) bool {
+	switch b {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// ruSuffixes are common Russian inflectional endings (noun case, adjective
+// agreement, and verb conjugation), longest first so e.g. "ами" is tried
+// before "и".
+var ruSuffixes = []string{
+	"иями", "ями", "ами", "его", "ому", "ему", "ыми", "ими", "ого",
+	"иям", "иях", "ией", "ешь", "ете",
+	"ей", "ов", "ев", "ем", "ам", "ям", "ах", "ях", "ии",
+	"ию", "ия", "ие", "ть", "ет", "ут", "ют",
+	"ла", "ло", "ли", "на", "но", "ны",
+	"ая", "яя", "ое", "ее", "ый", "ий", "ой", "ым", "им",
+	"а", "я", "о", "е", "ы", "и", "у", "ю", "й",
+}
+
+// stemRussian is a simplified Snowball-style Russian stemmer: it strips
+// the first matching ending in ruSuffixes. It skips the full Snowball
+// algorithm's RV-region and perfective-gerund handling, so it's coarser
+// than a real Snowball stemmer, but enough to collapse common case and
+// conjugation variants onto the same index term.
+func stemRussian(word string) string {
+	runes := []rune(word)
+	if len(runes) <= 3 {
+		return word
+	}
+	for _, suf := range ruSuffixes {
+		sufRunes := []rune(suf)
+		if len(runes) <= len(sufRunes)+2 {
+			continue
+		}
+		if strings.HasSuffix(word, suf) {
+			return string(runes[:len(runes)-len(sufRunes)])
+		}
+	}
+	return word
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestStemEnglish(t *testing.T) {
+	tests := []struct{ word, want string }{
+		{"running", "run"},
+		{"runs", "run"},
+		{"run", "run"},
+		{"hoped", "hop"},
+		{"hopping", "hop"},
+		{"parties", "party"},
+		{"happiness", "happi"},
+		{"educational", "educate"},
+	}
+	for _, tt := range tests {
+		if got := stemEnglish(tt.word); got != tt.want {
+			t.Errorf("stemEnglish(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+// TestStemRussianInflectedFormsShareAStem locks down the ruSuffixes fix: an
+// overlapping shorter suffix (e.g. "ей") must not shadow a longer one (e.g.
+// "ией") just because it sorted earlier, or related inflected forms of the
+// same word stem differently from each other.
+func TestStemRussianInflectedFormsShareAStem(t *testing.T) {
+	forms := []string{"армия", "армии", "армией", "армиям", "армиях", "армиями"}
+	var want string
+	for i, w := range forms {
+		got := stemRussian(w)
+		if i == 0 {
+			want = got
+			continue
+		}
+		if got != want {
+			t.Errorf("stemRussian(%q) = %q, want %q (same as stemRussian(%q))", w, got, want, forms[0])
+		}
+	}
+}
+
+func TestRuSuffixesOrdering(t *testing.T) {
+	// No suffix may be shadowed by a shorter one earlier in the slice that
+	// it ends with, or stemRussian's first-match loop would never reach
+	// the longer, more specific suffix.
+	seen := make(map[string]bool, len(ruSuffixes))
+	for _, s := range ruSuffixes {
+		if seen[s] {
+			t.Errorf("ruSuffixes contains duplicate %q", s)
+		}
+		seen[s] = true
+	}
+	for i, a := range ruSuffixes {
+		aRunes := []rune(a)
+		for j := i + 1; j < len(ruSuffixes); j++ {
+			b := ruSuffixes[j]
+			bRunes := []rune(b)
+			if len(bRunes) > len(aRunes) && strHasSuffixRunes(b, a) {
+				t.Errorf("ruSuffixes: %q (index %d) shadows longer suffix %q (index %d), which sorts after it", a, i, b, j)
+			}
+		}
+	}
+}
+
+func strHasSuffixRunes(word, suffix string) bool {
+	w, s := []rune(word), []rune(suffix)
+	if len(s) > len(w) {
+		return false
+	}
+	for i := 1; i <= len(s); i++ {
+		if w[len(w)-i] != s[len(s)-i] {
+			return false
+		}
+	}
+	return true
+}
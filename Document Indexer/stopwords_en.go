@@ -0,0 +1,28 @@
+package main
+
+// enStopWords are common English function words, dropped before stemming
+// so they don't dominate term-frequency statistics.
+var enStopWords = toSet(
+	"a", "an", "the", "and", "or", "but", "if", "then", "else", "of", "at",
+	"by", "for", "with", "about", "against", "between", "into", "through",
+	"during", "before", "after", "above", "below", "to", "from", "up",
+	"down", "in", "out", "on", "off", "over", "under", "again", "further",
+	"once", "here", "there", "when", "where", "why", "how", "all", "any",
+	"both", "each", "few", "more", "most", "other", "some", "such", "no",
+	"nor", "not", "only", "own", "same", "so", "than", "too", "very", "s",
+	"t", "can", "will", "just", "don", "should", "now", "is", "am", "are",
+	"was", "were", "be", "been", "being", "have", "has", "had", "having",
+	"do", "does", "did", "doing", "i", "me", "my", "myself", "we", "our",
+	"ours", "ourselves", "you", "your", "yours", "yourself", "yourselves",
+	"he", "him", "his", "himself", "she", "her", "hers", "herself", "it",
+	"its", "itself", "they", "them", "their", "theirs", "themselves",
+	"what", "which", "who", "whom", "this", "that", "these", "those",
+)
+
+func toSet(words ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[w] = struct{}{}
+	}
+	return set
+}